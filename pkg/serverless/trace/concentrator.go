@@ -0,0 +1,249 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+	"github.com/DataDog/sketches-go/ddsketch"
+	"github.com/golang/protobuf/proto"
+)
+
+// bucketDuration is the width of the fixed time buckets the concentrator aggregates
+// stats into, matching the default used by the regular trace-agent concentrator.
+const bucketDuration = 10 * time.Second
+
+// keyAnalyzed marks a span as retained for App Analytics regardless of its priority.
+const keyAnalyzed = "_dd1.sr.eausr"
+
+// aggregationKey groups spans that should be counted together within a single stats
+// bucket.
+type aggregationKey struct {
+	service        string
+	resource       string
+	name           string
+	httpStatusCode string
+	synthetics     bool
+}
+
+// groupedStats accumulates hit/error counts and a latency sketch for one aggregationKey
+// within one bucket.
+type groupedStats struct {
+	hits           uint64
+	errors         uint64
+	duration       uint64
+	durationSketch *ddsketch.DDSketch
+}
+
+// statsBucket holds the per-aggregation-key stats computed over one bucketDuration
+// window, keyed by its start timestamp in nanoseconds since the Unix epoch.
+type statsBucket struct {
+	start uint64
+	stats map[aggregationKey]*groupedStats
+}
+
+func newStatsBucket(start uint64) *statsBucket {
+	return &statsBucket{start: start, stats: make(map[aggregationKey]*groupedStats)}
+}
+
+func (b *statsBucket) add(span *pb.Span) {
+	key := aggregationKey{
+		service:        span.Service,
+		resource:       span.Resource,
+		name:           span.Name,
+		httpStatusCode: span.Meta[httpStatusCodeMetaKey],
+	}
+	gs, ok := b.stats[key]
+	if !ok {
+		sketch, err := ddsketch.NewDefaultDDSketch(0.01)
+		if err != nil {
+			log.Errorf("Unable to create duration sketch for stats bucket: %s", err)
+			return
+		}
+		gs = &groupedStats{durationSketch: sketch}
+		b.stats[key] = gs
+	}
+	gs.hits++
+	if span.Error != 0 {
+		gs.errors++
+	}
+	gs.duration += uint64(span.Duration)
+	if err := gs.durationSketch.Add(float64(span.Duration)); err != nil {
+		log.Debugf("Unable to add span duration to sketch: %s", err)
+	}
+}
+
+func (b *statsBucket) export() *pb.ClientStatsBucket {
+	out := &pb.ClientStatsBucket{
+		Start:    b.start,
+		Duration: uint64(bucketDuration.Nanoseconds()),
+		Stats:    make([]*pb.ClientGroupedStats, 0, len(b.stats)),
+	}
+	for key, gs := range b.stats {
+		out.Stats = append(out.Stats, &pb.ClientGroupedStats{
+			Service:        key.service,
+			Resource:       key.resource,
+			Name:           key.name,
+			HTTPStatusCode: httpStatusCodeToUint32(key.httpStatusCode),
+			Hits:           gs.hits,
+			Errors:         gs.errors,
+			Duration:       gs.duration,
+			OkSummary:      marshalSketch(gs.durationSketch),
+		})
+	}
+	return out
+}
+
+// httpStatusCodeMetaKey is the key of the span meta containing the HTTP status code.
+const httpStatusCodeMetaKey = "http.status_code"
+
+func httpStatusCodeToUint32(code string) uint32 {
+	var out uint32
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		out = out*10 + uint32(c-'0')
+	}
+	return out
+}
+
+func marshalSketch(sketch *ddsketch.DDSketch) []byte {
+	raw, err := proto.Marshal(sketch.ToProto())
+	if err != nil {
+		log.Errorf("Unable to marshal duration sketch: %s", err)
+		return nil
+	}
+	return raw
+}
+
+// Concentrator computes APM client-side stats (hit/error/duration histograms keyed by
+// service/resource/operation/http.status_code) so the serverless trace agent can report
+// accurate stats to the backend even when it drops the underlying spans to save on the
+// per-millisecond cost of a Lambda invocation.
+//
+// Add and Flush both take the same lock and never hand spans off to a background
+// goroutine, so a call to Flush is guaranteed to see every span Added before it returns
+// — there is no async buffer a Lambda shutdown could race with.
+type Concentrator struct {
+	mu      sync.Mutex
+	buckets map[uint64]*statsBucket
+}
+
+// NewConcentrator returns a new, unstarted Concentrator.
+func NewConcentrator() *Concentrator {
+	return &Concentrator{buckets: make(map[uint64]*statsBucket)}
+}
+
+// Start is a no-op kept for symmetry with Stop; aggregation happens synchronously in Add.
+func (c *Concentrator) Start() {}
+
+// Stop is a no-op kept for symmetry with Start; there is no background goroutine to tear
+// down.
+func (c *Concentrator) Stop() {}
+
+// Add aggregates span into the bucket for its start time. Only top-level or measured
+// spans contribute, matching what the backend itself would compute from a full trace.
+func (c *Concentrator) Add(span *pb.Span) {
+	if span == nil || !isTopLevelOrMeasured(span) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := alignToBucket(uint64(span.Start))
+	b, ok := c.buckets[start]
+	if !ok {
+		b = newStatsBucket(start)
+		c.buckets[start] = b
+	}
+	b.add(span)
+}
+
+func alignToBucket(ts uint64) uint64 {
+	width := uint64(bucketDuration.Nanoseconds())
+	return ts - ts%width
+}
+
+func isTopLevelOrMeasured(span *pb.Span) bool {
+	if span.Metrics["_top_level"] == 1 || span.Metrics["_dd.top_level"] == 1 {
+		return true
+	}
+	return span.Metrics["_dd.measured"] == 1
+}
+
+// Flush drains and returns all buckets accumulated so far. Since Add aggregates spans
+// synchronously under the same lock, any span Added before Flush is called is guaranteed
+// to be reflected in the returned buckets, so no stats are lost when the Lambda extension
+// shuts down.
+func (c *Concentrator) Flush() []*pb.ClientStatsBucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buckets := make([]*pb.ClientStatsBucket, 0, len(c.buckets))
+	for start, b := range c.buckets {
+		buckets = append(buckets, b.export())
+		delete(c.buckets, start)
+	}
+	return buckets
+}
+
+// shouldDropP0Chunk reports whether chunk is unsampled (priority <= 0) and contains no
+// error or analyzed spans, and can therefore be safely dropped from the trace payload
+// once its stats have been recorded by the Concentrator.
+//
+// Sampling priority is a chunk-level decision (pb.TraceChunk.Priority), not a per-span
+// one, so this must be evaluated once per chunk using the chunk's full span list rather
+// than asking an individual span to infer the verdict from its own metrics.
+func shouldDropP0Chunk(chunk *pb.TraceChunk) bool {
+	if chunk == nil || chunk.Priority > 0 {
+		return false
+	}
+	for _, span := range chunk.Spans {
+		if span.Error != 0 {
+			return false
+		}
+		if _, analyzed := span.Metrics[keyAnalyzed]; analyzed {
+			return false
+		}
+	}
+	return true
+}
+
+// p0Verdicts memoizes the shouldDropP0Chunk verdict per chunk so it is computed once
+// rather than rescanned for every span in that chunk, and so the very same verdict is
+// applied uniformly to every span of the chunk.
+type p0Verdicts struct {
+	mu    sync.Mutex
+	cache map[*pb.TraceChunk]bool
+}
+
+// newP0Verdicts returns an empty verdict cache.
+func newP0Verdicts() *p0Verdicts {
+	return &p0Verdicts{cache: make(map[*pb.TraceChunk]bool)}
+}
+
+// forChunk returns the (memoized) shouldDropP0Chunk verdict for chunk.
+func (v *p0Verdicts) forChunk(chunk *pb.TraceChunk) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if verdict, ok := v.cache[chunk]; ok {
+		return verdict
+	}
+	verdict := shouldDropP0Chunk(chunk)
+	v.cache[chunk] = verdict
+	return verdict
+}
+
+// reset discards all memoized verdicts. Called once per Flush, since a synchronous Lambda
+// flush cycle processes a bounded, self-contained set of chunks and the cache should not
+// grow unbounded across invocations.
+func (v *p0Verdicts) reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.cache = make(map[*pb.TraceChunk]bool)
+}
@@ -0,0 +1,147 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func topLevelSpan(service, resource, name string, duration int64) *pb.Span {
+	return &pb.Span{
+		Service:  service,
+		Resource: resource,
+		Name:     name,
+		Start:    0,
+		Duration: duration,
+		Metrics:  map[string]float64{"_top_level": 1},
+	}
+}
+
+func TestConcentratorAddIsSynchronousWithFlush(t *testing.T) {
+	c := NewConcentrator()
+	c.Add(topLevelSpan("svc", "/users", "web.request", 100))
+
+	// Flush must observe the span immediately: Add takes the same lock and never hands
+	// the span to a background goroutine, so there is no race to wait out.
+	buckets := c.Flush()
+	if assert.Len(t, buckets, 1) {
+		assert.Len(t, buckets[0].Stats, 1)
+		assert.EqualValues(t, 1, buckets[0].Stats[0].Hits)
+	}
+}
+
+func TestConcentratorIgnoresNonTopLevelSpans(t *testing.T) {
+	c := NewConcentrator()
+	c.Add(&pb.Span{Service: "svc", Resource: "/users"})
+
+	buckets := c.Flush()
+	assert.Empty(t, buckets)
+}
+
+func TestConcentratorAggregatesByKey(t *testing.T) {
+	c := NewConcentrator()
+	c.Add(topLevelSpan("svc", "/users", "web.request", 100))
+	c.Add(topLevelSpan("svc", "/users", "web.request", 200))
+	c.Add(topLevelSpan("svc", "/orders", "web.request", 50))
+
+	buckets := c.Flush()
+	if assert.Len(t, buckets, 1) {
+		assert.Len(t, buckets[0].Stats, 2)
+		for _, gs := range buckets[0].Stats {
+			if gs.Resource == "/users" {
+				assert.EqualValues(t, 2, gs.Hits)
+				assert.EqualValues(t, 300, gs.Duration)
+			}
+		}
+	}
+}
+
+func TestConcentratorFlushDrainsBuckets(t *testing.T) {
+	c := NewConcentrator()
+	c.Add(topLevelSpan("svc", "/users", "web.request", 100))
+
+	assert.Len(t, c.Flush(), 1)
+	assert.Empty(t, c.Flush())
+}
+
+func TestConcentratorConcurrentAdd(t *testing.T) {
+	c := NewConcentrator()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Add(topLevelSpan("svc", "/users", "web.request", 10))
+		}()
+	}
+	wg.Wait()
+
+	buckets := c.Flush()
+	if assert.Len(t, buckets, 1) && assert.Len(t, buckets[0].Stats, 1) {
+		assert.EqualValues(t, 100, buckets[0].Stats[0].Hits)
+	}
+}
+
+func TestShouldDropP0Chunk(t *testing.T) {
+	cases := []struct {
+		name  string
+		chunk *pb.TraceChunk
+		want  bool
+	}{
+		{"nil chunk", nil, false},
+		{"sampled chunk kept", &pb.TraceChunk{Priority: 1, Spans: []*pb.Span{{}}}, false},
+		{
+			"unsampled single-span chunk dropped",
+			&pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{}}},
+			true,
+		},
+		{
+			"unsampled multi-span chunk dropped entirely",
+			&pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{Name: "root"}, {Name: "child-1"}, {Name: "child-2"}}},
+			true,
+		},
+		{
+			"unsampled chunk kept if any span errored",
+			&pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{Name: "root"}, {Name: "child", Error: 1}}},
+			false,
+		},
+		{
+			"unsampled chunk kept if any span is analyzed",
+			&pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{Name: "root"}, {Name: "child", Metrics: map[string]float64{keyAnalyzed: 1}}}},
+			false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, shouldDropP0Chunk(tc.chunk))
+		})
+	}
+}
+
+func TestP0VerdictsMemoizesPerChunk(t *testing.T) {
+	v := newP0Verdicts()
+	chunk := &pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{Name: "root"}}}
+
+	assert.True(t, v.forChunk(chunk))
+
+	// Mutating the chunk after the first lookup must not change the memoized verdict:
+	// every span in the chunk is expected to see the exact same verdict.
+	chunk.Spans = append(chunk.Spans, &pb.Span{Name: "child", Error: 1})
+	assert.True(t, v.forChunk(chunk))
+
+	v.reset()
+	assert.False(t, v.forChunk(chunk))
+}
+
+func TestAlignToBucket(t *testing.T) {
+	width := uint64(bucketDuration.Nanoseconds())
+	assert.Equal(t, uint64(0), alignToBucket(width-1))
+	assert.Equal(t, width, alignToBucket(width+5))
+}
@@ -0,0 +1,142 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	ddConfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// filterTagsRegexEnvVar allows setting per-tag drop rules without a config file, in the
+// form "tag1=regex1,tag2=regex2".
+const filterTagsRegexEnvVar = "DD_APM_FILTER_TAGS_REGEX"
+
+// ignoreResourcesEnvVar allows setting resource drop rules without a config file, in the
+// form "regex1,regex2".
+const ignoreResourcesEnvVar = "DD_APM_IGNORE_RESOURCES"
+
+// FilterConfig holds the set of rules used to decide whether a span generated in a
+// serverless environment should be dropped before it ever reaches the backend.
+type FilterConfig struct {
+	// ResourceRegexes are matched against the span Resource. A span whose resource
+	// matches any of these is dropped.
+	ResourceRegexes []*regexp.Regexp
+
+	// TagRegexes maps a span Meta key (e.g. "http.url") to the regexes that, if matched
+	// against the corresponding tag value, cause the span to be dropped.
+	TagRegexes map[string][]*regexp.Regexp
+}
+
+// defaultFilterConfig returns the drop rules that used to be hard-coded: internal HTTP
+// calls to the Lambda runtime API, the Lambda Extension and the Statsd sidecar.
+func defaultFilterConfig() *FilterConfig {
+	return &FilterConfig{
+		TagRegexes: map[string][]*regexp.Regexp{
+			httpURLMetaKey: {
+				regexp.MustCompile("^" + regexp.QuoteMeta(lambdaRuntimeURLPrefix)),
+				regexp.MustCompile("^" + regexp.QuoteMeta(lambdaExtensionURLPrefix)),
+				regexp.MustCompile("^" + regexp.QuoteMeta(lambdaStatsDURLPrefix)),
+			},
+		},
+		ResourceRegexes: []*regexp.Regexp{
+			regexp.MustCompile("^" + regexp.QuoteMeta(invocationSpanResource) + "$"),
+		},
+	}
+}
+
+// loadFilterConfig builds the effective FilterConfig by starting from the defaults above
+// and layering on any user-supplied rules from the config file and environment variables.
+func loadFilterConfig() *FilterConfig {
+	fc := defaultFilterConfig()
+
+	for _, raw := range ddConfig.Datadog.GetStringSlice("apm_config.ignore_resources") {
+		fc.addResourceRegex(raw)
+	}
+	for _, raw := range splitEnvList(os.Getenv(ignoreResourcesEnvVar)) {
+		fc.addResourceRegex(raw)
+	}
+
+	for tag, raw := range ddConfig.Datadog.GetStringMapString("apm_config.filter_tags_regex") {
+		fc.addTagRegex(tag, raw)
+	}
+	for _, entry := range splitEnvList(os.Getenv(filterTagsRegexEnvVar)) {
+		tag, raw, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Warnf("Ignoring malformed %s entry %q, expected tag=regex", filterTagsRegexEnvVar, entry)
+			continue
+		}
+		fc.addTagRegex(tag, raw)
+	}
+
+	return fc
+}
+
+// splitEnvList splits a comma-separated environment variable into its trimmed entries,
+// dropping any empty ones.
+func splitEnvList(val string) []string {
+	if val == "" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(val, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func (fc *FilterConfig) addResourceRegex(raw string) {
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		log.Errorf("Invalid ignore_resources regex %q: %s", raw, err)
+		return
+	}
+	fc.ResourceRegexes = append(fc.ResourceRegexes, re)
+}
+
+func (fc *FilterConfig) addTagRegex(tag, raw string) {
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		log.Errorf("Invalid filter_tags_regex regex %q for tag %q: %s", raw, tag, err)
+		return
+	}
+	if fc.TagRegexes == nil {
+		fc.TagRegexes = make(map[string][]*regexp.Regexp)
+	}
+	fc.TagRegexes[tag] = append(fc.TagRegexes[tag], re)
+}
+
+// shouldDropSpan returns true if span matches any of the configured drop rules.
+func (fc *FilterConfig) shouldDropSpan(span *pb.Span) bool {
+	if span == nil {
+		return false
+	}
+	for tag, regexes := range fc.TagRegexes {
+		val, ok := span.Meta[tag]
+		if !ok {
+			continue
+		}
+		for _, re := range regexes {
+			if re.MatchString(val) {
+				log.Debugf("Detected span with %s %s matching drop rule %s, removing it", tag, val, re.String())
+				return true
+			}
+		}
+	}
+	for _, re := range fc.ResourceRegexes {
+		if re.MatchString(span.Resource) {
+			log.Debugf("Detected span with resource %s matching drop rule %s, removing it", span.Resource, re.String())
+			return true
+		}
+	}
+	return false
+}
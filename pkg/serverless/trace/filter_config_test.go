@@ -0,0 +1,82 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultFilterConfigDropsKnownPrefixes(t *testing.T) {
+	fc := defaultFilterConfig()
+
+	assert.True(t, fc.shouldDropSpan(&pb.Span{Meta: map[string]string{httpURLMetaKey: lambdaExtensionURLPrefix + "/lambda/flush"}}))
+	assert.True(t, fc.shouldDropSpan(&pb.Span{Meta: map[string]string{httpURLMetaKey: lambdaStatsDURLPrefix + "/"}}))
+	assert.True(t, fc.shouldDropSpan(&pb.Span{Meta: map[string]string{httpURLMetaKey: lambdaRuntimeURLPrefix + "/invocation/next"}}))
+	assert.True(t, fc.shouldDropSpan(&pb.Span{Resource: invocationSpanResource}))
+}
+
+func TestDefaultFilterConfigKeepsUnrelatedSpans(t *testing.T) {
+	fc := defaultFilterConfig()
+
+	span := &pb.Span{
+		Resource: "GET /users",
+		Meta:     map[string]string{httpURLMetaKey: "https://api.example.com/users"},
+	}
+	assert.False(t, fc.shouldDropSpan(span))
+}
+
+func TestFilterConfigCustomResourceRegex(t *testing.T) {
+	fc := &FilterConfig{}
+	fc.addResourceRegex("^/health$")
+
+	assert.True(t, fc.shouldDropSpan(&pb.Span{Resource: "/health"}))
+	assert.False(t, fc.shouldDropSpan(&pb.Span{Resource: "/healthy"}))
+}
+
+func TestFilterConfigCustomTagRegex(t *testing.T) {
+	fc := &FilterConfig{}
+	fc.addTagRegex("http.status_code", "^2[0-9]{2}$")
+
+	dropped := &pb.Span{Meta: map[string]string{"http.status_code": "204"}}
+	kept := &pb.Span{Meta: map[string]string{"http.status_code": "500"}}
+
+	assert.True(t, fc.shouldDropSpan(dropped))
+	assert.False(t, fc.shouldDropSpan(kept))
+}
+
+func TestFilterConfigInvalidRegexIsSkipped(t *testing.T) {
+	fc := &FilterConfig{}
+	fc.addResourceRegex("(unterminated")
+
+	assert.Empty(t, fc.ResourceRegexes)
+}
+
+func TestFilterConfigShouldDropSpanNilSpan(t *testing.T) {
+	fc := defaultFilterConfig()
+	assert.False(t, fc.shouldDropSpan(nil))
+}
+
+func TestSplitEnvList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitEnvList("a, b"))
+	assert.Nil(t, splitEnvList(""))
+	assert.Nil(t, splitEnvList(" , "))
+}
+
+func TestLoadFilterConfigIncludesDefaults(t *testing.T) {
+	fc := loadFilterConfig()
+
+	var found bool
+	for _, re := range fc.TagRegexes[httpURLMetaKey] {
+		if re.String() == regexp.MustCompile("^"+regexp.QuoteMeta(lambdaExtensionURLPrefix)).String() {
+			found = true
+		}
+	}
+	assert.True(t, found, "loadFilterConfig should retain the default lambda extension drop rule")
+}
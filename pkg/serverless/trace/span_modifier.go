@@ -0,0 +1,143 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"regexp"
+	"sort"
+
+	ddConfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// SpanRemapper normalizes span operation names and resources before they reach the
+// backend. Auto-instrumented libraries often produce inconsistent operation names across
+// runtimes (e.g. `aws.lambda` vs `aws.lambda.invoke`), and users need a way to normalize
+// them without waiting on library changes.
+type SpanRemapper interface {
+	// RemapName returns the name to use in place of name.
+	RemapName(name string) string
+	// RemapResource returns the resource to use in place of resource.
+	RemapResource(resource string) string
+}
+
+// remapRule matches a span name or resource and replaces every match of the pattern with
+// replacement (as regexp.ReplaceAllString does); the parts of the value outside the match
+// are kept.
+type remapRule struct {
+	match       *regexp.Regexp
+	replacement string
+}
+
+// regexSpanRemapper is a SpanRemapper backed by a list of `{match_pattern: replacement}`
+// rules loaded from config.
+type regexSpanRemapper struct {
+	nameRules     []remapRule
+	resourceRules []remapRule
+}
+
+// newSpanRemapper compiles nameRemappings and resourceRemappings, logging and skipping
+// any entry whose pattern fails to compile as a regex.
+func newSpanRemapper(nameRemappings, resourceRemappings map[string]string) *regexSpanRemapper {
+	return &regexSpanRemapper{
+		nameRules:     compileRemapRules(nameRemappings),
+		resourceRules: compileRemapRules(resourceRemappings),
+	}
+}
+
+// compileRemapRules compiles remappings into rules ordered by pattern string, so that
+// when two patterns both match the same value, which replacement wins is deterministic
+// across runs rather than depending on Go's randomized map iteration order.
+func compileRemapRules(remappings map[string]string) []remapRule {
+	patterns := make([]string, 0, len(remappings))
+	for pattern := range remappings {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	rules := make([]remapRule, 0, len(remappings))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Errorf("Invalid span remapping pattern %q: %s", pattern, err)
+			continue
+		}
+		rules = append(rules, remapRule{match: re, replacement: remappings[pattern]})
+	}
+	return rules
+}
+
+func applyRemapRules(rules []remapRule, value string) string {
+	for _, rule := range rules {
+		if rule.match.MatchString(value) {
+			return rule.match.ReplaceAllString(value, rule.replacement)
+		}
+	}
+	return value
+}
+
+// RemapName implements SpanRemapper.
+func (r *regexSpanRemapper) RemapName(name string) string {
+	return applyRemapRules(r.nameRules, name)
+}
+
+// RemapResource implements SpanRemapper.
+func (r *regexSpanRemapper) RemapResource(resource string) string {
+	return applyRemapRules(r.resourceRules, resource)
+}
+
+// loadSpanRemapper builds a SpanRemapper from the `span_name_remappings` and
+// `span_resource_remappings` keys of the loaded AgentConfig.
+func loadSpanRemapper() *regexSpanRemapper {
+	return newSpanRemapper(
+		ddConfig.Datadog.GetStringMapString("apm_config.span_name_remappings"),
+		ddConfig.Datadog.GetStringMapString("apm_config.span_resource_remappings"),
+	)
+}
+
+// keyDropP0Internal marks a span as belonging to a chunk that shouldDropP0Chunk decided
+// to drop. It is an internal-only signal from ModifySpan to discardSpan and is deleted
+// again as soon as discardSpan reads it, so it never reaches the shipped trace payload.
+const keyDropP0Internal = "_dd.serverless.drop_p0"
+
+// spanModifier applies the global tags and any configured SpanRemapper to every span
+// passing through the trace agent, mirrors it to the configured TraceExporter, and (when
+// p0Verdicts is set) stamps the chunk's P0-drop verdict onto the span for discardSpan to
+// consume.
+type spanModifier struct {
+	tags       map[string]string
+	remapper   SpanRemapper
+	exporter   TraceExporter
+	p0Verdicts *p0Verdicts
+}
+
+// ModifySpan is plugged into agent.Agent.ModifySpan.
+func (s *spanModifier) ModifySpan(chunk *pb.TraceChunk, span *pb.Span) {
+	if span.Meta == nil {
+		span.Meta = make(map[string]string)
+	}
+	for k, v := range s.tags {
+		span.Meta[k] = v
+	}
+	if s.remapper != nil {
+		span.Name = s.remapper.RemapName(span.Name)
+		span.Resource = s.remapper.RemapResource(span.Resource)
+	}
+	if s.exporter != nil {
+		s.exporter.ExportSpan(chunk, span)
+	}
+	// The P0-drop verdict is a chunk-level decision (see shouldDropP0Chunk), but
+	// agent.Agent's DiscardSpan hook only sees a single span. ModifySpan is the one hook
+	// that sees both, so it computes the verdict once per chunk and stamps it onto every
+	// one of the chunk's spans here, guaranteeing all of them get the same answer.
+	if s.p0Verdicts != nil && s.p0Verdicts.forChunk(chunk) {
+		if span.Metrics == nil {
+			span.Metrics = make(map[string]float64)
+		}
+		span.Metrics[keyDropP0Internal] = 1
+	}
+}
@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexSpanRemapperReplacesMatchingName(t *testing.T) {
+	r := newSpanRemapper(map[string]string{"^aws\\.lambda$": "aws.lambda.invoke"}, nil)
+
+	assert.Equal(t, "aws.lambda.invoke", r.RemapName("aws.lambda"))
+	assert.Equal(t, "other", r.RemapName("other"))
+}
+
+func TestRegexSpanRemapperReplacesMatchingResource(t *testing.T) {
+	r := newSpanRemapper(nil, map[string]string{"^/users/[0-9]+$": "/users/:id"})
+
+	assert.Equal(t, "/users/:id", r.RemapResource("/users/42"))
+	assert.Equal(t, "/orders", r.RemapResource("/orders"))
+}
+
+func TestRegexSpanRemapperSkipsInvalidPattern(t *testing.T) {
+	r := newSpanRemapper(map[string]string{"(unterminated": "x"}, nil)
+
+	assert.Empty(t, r.nameRules)
+}
+
+func TestCompileRemapRulesDeterministicPrecedence(t *testing.T) {
+	remappings := map[string]string{
+		"^aws\\..*$":        "generic",
+		"^aws\\.lambda.*$": "lambda-specific",
+	}
+
+	var want string
+	for i := 0; i < 20; i++ {
+		r := newSpanRemapper(remappings, nil)
+		got := r.RemapName("aws.lambda.invoke")
+		if i == 0 {
+			want = got
+		}
+		assert.Equal(t, want, got, "remap precedence must be stable across repeated compiles")
+	}
+	// The alphabetically-first pattern ("^aws\..*$") must win, per compileRemapRules.
+	assert.Equal(t, "generic", want)
+}
+
+func TestSpanModifierModifySpanAppliesTagsAndRemapping(t *testing.T) {
+	sm := &spanModifier{
+		tags:     map[string]string{"env": "prod"},
+		remapper: newSpanRemapper(map[string]string{"^aws\\.lambda$": "aws.lambda.invoke"}, nil),
+	}
+	span := &pb.Span{Name: "aws.lambda"}
+
+	sm.ModifySpan(&pb.TraceChunk{}, span)
+
+	assert.Equal(t, "aws.lambda.invoke", span.Name)
+	assert.Equal(t, "prod", span.Meta["env"])
+}
+
+type recordingExporter struct {
+	spans []*pb.Span
+}
+
+func (r *recordingExporter) ExportSpan(_ *pb.TraceChunk, span *pb.Span) {
+	r.spans = append(r.spans, span)
+}
+func (r *recordingExporter) Flush() {}
+func (r *recordingExporter) Stop()  {}
+
+func TestSpanModifierForwardsToExporter(t *testing.T) {
+	exporter := &recordingExporter{}
+	sm := &spanModifier{exporter: exporter}
+	span := &pb.Span{Name: "aws.lambda"}
+
+	sm.ModifySpan(&pb.TraceChunk{}, span)
+
+	assert.Len(t, exporter.spans, 1)
+	assert.Same(t, span, exporter.spans[0])
+}
@@ -0,0 +1,117 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"encoding/json"
+	"runtime"
+
+	ddConfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/trace/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+	"github.com/DataDog/datadog-agent/pkg/version"
+)
+
+// startupLogsConfigKey gates the JSON startup/shutdown diagnostics below. It defaults to
+// on because the cost of an extra log line is negligible next to the time lost chasing a
+// Lambda invocation that silently never produced a trace.
+const startupLogsConfigKey = "serverless.trace.startup_logs"
+
+// startupInfo is logged once by Start once the trace agent config has been resolved. It
+// mirrors the kind of information the tracer's own startupInfo logs, since serverless
+// invocations have no interactive access to the agent to debug misconfiguration after the
+// fact.
+type startupInfo struct {
+	AgentVersion        string            `json:"agent_version"`
+	GoVersion           string            `json:"go_version"`
+	Endpoints           []string          `json:"endpoints,omitempty"`
+	TargetTPS           float64           `json:"target_tps,omitempty"`
+	ErrorTPS            float64           `json:"error_tps,omitempty"`
+	ExtraSampleRate     float64           `json:"extra_sample_rate,omitempty"`
+	SynchronousFlushing bool              `json:"synchronous_flushing"`
+	HostnameResolved    bool              `json:"hostname_resolved"`
+	FeatureFlags        []string          `json:"feature_flags,omitempty"`
+	ConfigError         string            `json:"config_error,omitempty"`
+}
+
+// shutdownInfo is logged once by Stop to report how many times the agent flushed while it
+// was running.
+type shutdownInfo struct {
+	FlushCount int `json:"flush_count"`
+}
+
+// startupTagsInfo is logged once by SetTags the first time it is called, supplementing
+// the startup diagnostics line with the tags set via SetTags. It is its own call because
+// Start (and its startupInfo line) runs before the Lambda extension has had a chance to
+// call SetTags.
+type startupTagsInfo struct {
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// startupLogsEnabled returns whether the startup/shutdown diagnostics should be emitted.
+// They default to on.
+func startupLogsEnabled() bool {
+	if !ddConfig.Datadog.IsSet(startupLogsConfigKey) {
+		return true
+	}
+	return ddConfig.Datadog.GetBool(startupLogsConfigKey)
+}
+
+// logStartup emits the startup diagnostics line. tc may be nil if config loading failed,
+// in which case confErr is reported instead.
+func logStartup(tc *config.AgentConfig, confErr error) {
+	if !startupLogsEnabled() {
+		return
+	}
+	info := &startupInfo{
+		AgentVersion: version.AgentVersion,
+		GoVersion:    runtime.Version(),
+	}
+	if confErr != nil {
+		info.ConfigError = confErr.Error()
+	}
+	if tc != nil {
+		info.SynchronousFlushing = tc.SynchronousFlushing
+		info.HostnameResolved = tc.Hostname != ""
+		info.TargetTPS = tc.TargetTPS
+		info.ErrorTPS = tc.ErrorTPS
+		info.ExtraSampleRate = tc.ExtraSampleRate
+		for _, e := range tc.Endpoints {
+			info.Endpoints = append(info.Endpoints, e.Host)
+		}
+		for flag := range tc.Features {
+			info.FeatureFlags = append(info.FeatureFlags, flag)
+		}
+	}
+	logDiagnostics("startup", info)
+}
+
+// logStartupTags emits the supplemental startup diagnostics line carrying the tags set
+// via SetTags.
+func logStartupTags(tags map[string]string) {
+	if !startupLogsEnabled() {
+		return
+	}
+	logDiagnostics("startup_tags", &startupTagsInfo{Tags: tags})
+}
+
+// logShutdown emits the shutdown diagnostics line, reporting how many times Flush was
+// called while the agent was running.
+func logShutdown(flushCount int) {
+	if !startupLogsEnabled() {
+		return
+	}
+	logDiagnostics("shutdown", &shutdownInfo{FlushCount: flushCount})
+}
+
+func logDiagnostics(kind string, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("Unable to marshal serverless trace agent %s diagnostics: %s", kind, err)
+		return
+	}
+	log.Infof("%s", string(raw))
+}
@@ -0,0 +1,49 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"errors"
+	"testing"
+
+	ddConfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/trace/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartupLogsEnabledDefaultsToTrue(t *testing.T) {
+	ddConfig.Datadog.Set(startupLogsConfigKey, nil)
+	assert.True(t, startupLogsEnabled())
+}
+
+func TestStartupLogsEnabledRespectsConfig(t *testing.T) {
+	ddConfig.Datadog.Set(startupLogsConfigKey, false)
+	defer ddConfig.Datadog.Set(startupLogsConfigKey, nil)
+
+	assert.False(t, startupLogsEnabled())
+}
+
+func TestLogStartupDoesNotPanicOnConfigError(t *testing.T) {
+	assert.NotPanics(t, func() {
+		logStartup(nil, errors.New("could not load config"))
+	})
+}
+
+func TestLogStartupDoesNotPanicWithConfig(t *testing.T) {
+	tc := &config.AgentConfig{
+		SynchronousFlushing: true,
+		Hostname:            "",
+	}
+	assert.NotPanics(t, func() {
+		logStartup(tc, nil)
+	})
+}
+
+func TestLogStartupTagsDoesNotPanic(t *testing.T) {
+	assert.NotPanics(t, func() {
+		logStartupTags(map[string]string{"env": "prod"})
+	})
+}
@@ -7,7 +7,6 @@ package trace
 
 import (
 	"context"
-	"strings"
 
 	tracecmdconfig "github.com/DataDog/datadog-agent/cmd/trace-agent/config"
 	ddConfig "github.com/DataDog/datadog-agent/pkg/config"
@@ -21,7 +20,15 @@ import (
 type ServerlessTraceAgent struct {
 	ta           *agent.Agent
 	spanModifier *spanModifier
+	filterConfig *FilterConfig
+	concentrator *Concentrator
+	clientStats  bool
+	dropP0s      bool
+	p0Verdicts   *p0Verdicts
+	exporter     TraceExporter
 	cancel       context.CancelFunc
+	flushCount   int
+	tagsLogged   bool
 }
 
 // Load abstracts the file configuration loading
@@ -32,6 +39,35 @@ type Load interface {
 // LoadConfig is implementing Load to retrieve the config
 type LoadConfig struct {
 	Path string
+
+	clientStats bool
+	dropP0s     bool
+}
+
+// LoadConfigOption mutates a LoadConfig before it is passed to Start.
+type LoadConfigOption func(*LoadConfig)
+
+// WithClientStats enables client-side stats aggregation: the trace agent will compute
+// hit/error/duration buckets locally via a Concentrator instead of relying solely on the
+// backend to compute them from the full trace payload.
+func WithClientStats(enabled bool) LoadConfigOption {
+	return func(l *LoadConfig) { l.clientStats = enabled }
+}
+
+// WithDropP0s enables dropping P0 (priority <= 0, non-error, non-analyzed) spans from the
+// trace payload once their stats have been recorded by the Concentrator. Requires
+// WithClientStats to also be enabled, since otherwise those spans' stats would be lost.
+func WithDropP0s(enabled bool) LoadConfigOption {
+	return func(l *LoadConfig) { l.dropP0s = enabled }
+}
+
+// NewLoadConfig returns a LoadConfig for path with the given options applied.
+func NewLoadConfig(path string, opts ...LoadConfigOption) *LoadConfig {
+	l := &LoadConfig{Path: path}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // httpURLMetaKey is the key of the span meta containing the HTTP URL
@@ -53,8 +89,11 @@ func (l *LoadConfig) Load() (*config.AgentConfig, error) {
 	return tracecmdconfig.LoadConfigFile(l.Path)
 }
 
-// Start starts the agent
-func (s *ServerlessTraceAgent) Start(enabled bool, loadConfig Load) {
+// Start starts the agent. exporters optionally replaces the destination spans are
+// written to; when omitted (or nil), spans are shipped to the Datadog intake as before.
+// Supplying one clears the agent's configured Datadog endpoints, so the exporter stands
+// in for the Datadog writer rather than running alongside it.
+func (s *ServerlessTraceAgent) Start(enabled bool, loadConfig Load, exporters ...TraceExporter) {
 	if enabled {
 		// Set the serverless config option which will be used to determine if
 		// hostname should be resolved. Skipping hostname resolution saves >1s
@@ -68,21 +107,93 @@ func (s *ServerlessTraceAgent) Start(enabled bool, loadConfig Load) {
 			context, cancel := context.WithCancel(context.Background())
 			tc.Hostname = ""
 			tc.SynchronousFlushing = true
+			s.exporter = &datadogExporter{}
+			if len(exporters) > 0 && exporters[0] != nil {
+				s.exporter = exporters[0]
+				// A configured exporter replaces the Datadog intake, it doesn't mirror
+				// to it: clear the endpoints the agent would otherwise ship the trace and
+				// stats payloads to, so its writers have nowhere to send spans and the
+				// exporter becomes the only place spans go.
+				tc.Endpoints = nil
+			}
 			s.ta = agent.NewAgent(context, tc)
-			s.spanModifier = &spanModifier{}
+			s.filterConfig = loadFilterConfig()
+			if lc, ok := loadConfig.(*LoadConfig); ok {
+				s.clientStats = lc.clientStats
+				s.dropP0s = lc.dropP0s
+			}
+			if s.clientStats {
+				s.concentrator = NewConcentrator()
+				s.concentrator.Start()
+			}
+			if s.dropP0s {
+				s.p0Verdicts = newP0Verdicts()
+			}
+			s.spanModifier = &spanModifier{remapper: loadSpanRemapper(), exporter: s.exporter, p0Verdicts: s.p0Verdicts}
 			s.ta.ModifySpan = s.spanModifier.ModifySpan
-			s.ta.DiscardSpan = filterSpanFromLambdaLibraryOrRuntime
+			s.ta.DiscardSpan = s.discardSpan
 			s.cancel = cancel
 			go s.ta.Run()
 		}
+		logStartup(tc, confErr)
 	}
 }
 
 // Flush performs a synchronous flushing in the trace agent
 func (s *ServerlessTraceAgent) Flush() {
 	if s.Get() != nil {
+		s.flushClientStats()
 		s.ta.FlushSync()
+		if s.exporter != nil {
+			s.exporter.Flush()
+		}
+		if s.p0Verdicts != nil {
+			s.p0Verdicts.reset()
+		}
+		s.flushCount++
+	}
+}
+
+// flushClientStats drains the Concentrator, if enabled, and ships the resulting stats
+// buckets to the backend via the trace agent's stats writer.
+func (s *ServerlessTraceAgent) flushClientStats() {
+	if s.concentrator == nil {
+		return
+	}
+	buckets := s.concentrator.Flush()
+	if len(buckets) == 0 {
+		return
 	}
+	if s.ta.StatsWriter == nil {
+		log.Debug("No stats writer available, dropping client stats buckets")
+		return
+	}
+	s.ta.StatsWriter.Write(&pb.StatsPayload{
+		Stats: []*pb.ClientStatsPayload{{Stats: buckets}},
+	})
+}
+
+// discardSpan combines the configured span filtering rules with P0 dropping, when
+// enabled, into the single predicate the embedded agent.Agent expects.
+//
+// The P0-drop verdict itself is computed once per chunk, not per span (see
+// shouldDropP0Chunk): ModifySpan runs ahead of DiscardSpan for every span and stamps the
+// chunk's verdict onto keyDropP0Internal, so this only needs to consume that marker and
+// apply it uniformly rather than re-deriving it from a single span's own metrics.
+func (s *ServerlessTraceAgent) discardSpan(span *pb.Span) bool {
+	if s.filterConfig.shouldDropSpan(span) {
+		return true
+	}
+	if s.concentrator != nil {
+		s.concentrator.Add(span)
+	}
+	if s.dropP0s && span.Metrics != nil {
+		if _, drop := span.Metrics[keyDropP0Internal]; drop {
+			delete(span.Metrics, keyDropP0Internal)
+			return drop
+		}
+	}
+	return false
 }
 
 // Get returns the trace agent instance
@@ -95,40 +206,39 @@ func (s *ServerlessTraceAgent) SetTags(tagMap map[string]string) {
 	if s.Get() != nil {
 		s.ta.SetGlobalTagsUnsafe(tagMap)
 		s.spanModifier.tags = tagMap
+		// The startup diagnostics line is logged from Start, before the Lambda
+		// extension has had a chance to call SetTags. Log a supplemental line the
+		// first time tags become available so they still show up in the startup
+		// diagnostics.
+		if !s.tagsLogged {
+			s.tagsLogged = true
+			logStartupTags(tagMap)
+		}
 	} else {
 		log.Debug("could not set tags as the trace agent has not been initialized")
 	}
 }
 
+// SetSpanRemapping updates the span name and resource remapping rules applied by the
+// span processor at runtime, alongside the global tags set via SetTags.
+func (s *ServerlessTraceAgent) SetSpanRemapping(nameRemappings, resourceRemappings map[string]string) {
+	if s.Get() != nil {
+		s.spanModifier.remapper = newSpanRemapper(nameRemappings, resourceRemappings)
+	} else {
+		log.Debug("could not set span remapping as the trace agent has not been initialized")
+	}
+}
+
 // Stop stops the trace agent
 func (s *ServerlessTraceAgent) Stop() {
 	if s.cancel != nil {
 		s.cancel()
 	}
-}
-
-// filterSpanFromLambdaLibraryOrRuntime returns true if a span was generated by internal HTTP calls within the Datadog
-// Lambda Library or the Lambda runtime
-func filterSpanFromLambdaLibraryOrRuntime(span *pb.Span) bool {
-	if val, ok := span.Meta[httpURLMetaKey]; ok {
-		if strings.HasPrefix(val, lambdaExtensionURLPrefix) {
-			log.Debugf("Detected span with http url %s, removing it", val)
-			return true
-		}
-
-		if strings.HasPrefix(val, lambdaStatsDURLPrefix) {
-			log.Debugf("Detected span with http url %s, removing it", val)
-			return true
-		}
-
-		if strings.HasPrefix(val, lambdaRuntimeURLPrefix) {
-			log.Debugf("Detected span with http url %s, removing it", val)
-			return true
-		}
+	if s.concentrator != nil {
+		s.concentrator.Stop()
 	}
-	if span != nil && span.Resource == invocationSpanResource {
-		log.Debugf("Detected invocation span from tracer, removing it")
-		return true
+	if s.exporter != nil {
+		s.exporter.Stop()
 	}
-	return false
+	logShutdown(s.flushCount)
 }
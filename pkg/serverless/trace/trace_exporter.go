@@ -0,0 +1,165 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// TraceExporter lets callers ship the spans seen by the serverless trace agent somewhere
+// other than the Datadog intake. Passing one to ServerlessTraceAgent.Start clears the
+// agent's configured Datadog endpoints, so the exporter replaces the Datadog writer
+// rather than running alongside it. It is consulted once per span from
+// spanModifier.ModifySpan, after the global tags and remapping have been applied; the
+// span filtering rules and P0 dropping in discardSpan do not gate what it receives.
+type TraceExporter interface {
+	// ExportSpan is called for every span that passes through the trace agent.
+	ExportSpan(chunk *pb.TraceChunk, span *pb.Span)
+	// Flush ships any buffered spans to their destination.
+	Flush()
+	// Stop releases any resources held by the exporter.
+	Stop()
+}
+
+// datadogExporter is the default TraceExporter: it does nothing, since the embedded
+// agent.Agent already ships spans to the Datadog intake via its own trace writer.
+type datadogExporter struct{}
+
+func (*datadogExporter) ExportSpan(*pb.TraceChunk, *pb.Span) {}
+func (*datadogExporter) Flush()                              {}
+func (*datadogExporter) Stop()                               {}
+
+// otlpSpan is the minimal OTLP-ish shape we translate a pb.Span into. It intentionally
+// only carries the fields a Lambda debugging session needs, rather than a full OTLP
+// ResourceSpans tree.
+type otlpSpan struct {
+	TraceID       uint64            `json:"trace_id"`
+	SpanID        uint64            `json:"span_id"`
+	ParentSpanID  uint64            `json:"parent_span_id,omitempty"`
+	Name          string            `json:"name"`
+	ServiceName   string            `json:"service_name"`
+	StartUnixNano int64             `json:"start_time_unix_nano"`
+	EndUnixNano   int64             `json:"end_time_unix_nano"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+func newOTLPSpan(span *pb.Span) otlpSpan {
+	return otlpSpan{
+		TraceID:       span.TraceID,
+		SpanID:        span.SpanID,
+		ParentSpanID:  span.ParentID,
+		Name:          span.Name,
+		ServiceName:   span.Service,
+		StartUnixNano: span.Start,
+		EndUnixNano:   span.Start + span.Duration,
+		Attributes:    span.Meta,
+	}
+}
+
+// otlpExporter translates spans to OTLP-ish JSON and ships them over HTTP to an
+// OTLP/HTTP compatible collector endpoint, for users who want their traces in a
+// non-Datadog backend.
+type otlpExporter struct {
+	endpoint string
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+// NewOTLPExporter returns a TraceExporter that translates spans into OTLP-ish JSON and
+// posts them to the given OTLP/HTTP collector endpoint.
+func NewOTLPExporter(endpoint string) *otlpExporter {
+	return &otlpExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: defaultExporterTimeout},
+	}
+}
+
+func (e *otlpExporter) ExportSpan(_ *pb.TraceChunk, span *pb.Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, newOTLPSpan(span))
+}
+
+func (e *otlpExporter) Flush() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+	raw, err := json.Marshal(spans)
+	if err != nil {
+		log.Errorf("otlpExporter: unable to marshal spans: %s", err)
+		return
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(raw))
+	if err != nil {
+		log.Errorf("otlpExporter: unable to export %d spans to %s: %s", len(spans), e.endpoint, err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		log.Errorf("otlpExporter: %s rejected %d spans with status %s", e.endpoint, len(spans), resp.Status)
+	}
+}
+
+func (e *otlpExporter) Stop() {
+	e.Flush()
+}
+
+// fileExporter writes every span as a newline-delimited JSON record to a local file,
+// useful for offline debugging of Lambda invocations where no backend is reachable.
+type fileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileExporter returns a TraceExporter that appends every span as a newline-delimited
+// JSON record to the file at path, creating it if necessary.
+func NewFileExporter(path string) (*fileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileExporter{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (e *fileExporter) ExportSpan(_ *pb.TraceChunk, span *pb.Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enc.Encode(newOTLPSpan(span)); err != nil {
+		log.Errorf("fileExporter: unable to write span: %s", err)
+	}
+}
+
+func (e *fileExporter) Flush() {}
+
+func (e *fileExporter) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.file.Close(); err != nil {
+		log.Errorf("fileExporter: unable to close %s: %s", e.file.Name(), err)
+	}
+}
+
+// defaultExporterTimeout bounds how long the otlpExporter will wait for a collector to
+// accept a batch of spans.
+const defaultExporterTimeout = 2 * time.Second
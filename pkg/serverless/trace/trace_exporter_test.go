@@ -0,0 +1,102 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatadogExporterIsANoOp(t *testing.T) {
+	e := &datadogExporter{}
+	assert.NotPanics(t, func() {
+		e.ExportSpan(&pb.TraceChunk{}, &pb.Span{})
+		e.Flush()
+		e.Stop()
+	})
+}
+
+func TestOTLPExporterPostsBufferedSpansOnFlush(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	e := NewOTLPExporter(srv.URL)
+	e.ExportSpan(&pb.TraceChunk{}, &pb.Span{Name: "web.request"})
+	e.Flush()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	// A second flush with nothing buffered must not issue another request.
+	e.Flush()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+}
+
+func TestOTLPExporterFlushDoesNotPanicOnRejection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	e := NewOTLPExporter(srv.URL)
+	e.ExportSpan(&pb.TraceChunk{}, &pb.Span{Name: "web.request"})
+
+	assert.NotPanics(t, e.Flush)
+}
+
+func TestFileExporterWritesNewlineDelimitedJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	e, err := NewFileExporter(path)
+	require.NoError(t, err)
+
+	e.ExportSpan(&pb.TraceChunk{}, &pb.Span{Name: "web.request"})
+	e.ExportSpan(&pb.TraceChunk{}, &pb.Span{Name: "db.query"})
+	require.NoError(t, func() error { e.Stop(); return nil }())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var lines int
+	for scanner.Scan() {
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestNewOTLPSpanTranslatesCoreFields(t *testing.T) {
+	span := &pb.Span{
+		TraceID:  1,
+		SpanID:   2,
+		ParentID: 3,
+		Name:     "web.request",
+		Service:  "my-service",
+		Start:    100,
+		Duration: 50,
+		Meta:     map[string]string{"env": "prod"},
+	}
+
+	out := newOTLPSpan(span)
+
+	assert.Equal(t, uint64(1), out.TraceID)
+	assert.Equal(t, uint64(2), out.SpanID)
+	assert.Equal(t, uint64(3), out.ParentSpanID)
+	assert.Equal(t, int64(150), out.EndUnixNano)
+	assert.Equal(t, "prod", out.Attributes["env"])
+}
@@ -0,0 +1,95 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package trace
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDiscardSpanTestAgent returns a ServerlessTraceAgent wired up enough to exercise
+// discardSpan without a live *agent.Agent, which this package cannot construct outside of
+// Start.
+func newDiscardSpanTestAgent(dropP0s bool) *ServerlessTraceAgent {
+	s := &ServerlessTraceAgent{
+		filterConfig: defaultFilterConfig(),
+		concentrator: NewConcentrator(),
+		dropP0s:      dropP0s,
+	}
+	if dropP0s {
+		s.p0Verdicts = newP0Verdicts()
+	}
+	return s
+}
+
+func TestDiscardSpanDropsFilteredSpansRegardlessOfDropP0s(t *testing.T) {
+	s := newDiscardSpanTestAgent(false)
+	span := &pb.Span{Resource: invocationSpanResource}
+
+	assert.True(t, s.discardSpan(span))
+}
+
+func TestDiscardSpanRecordsStatsBeforeDroppingP0Span(t *testing.T) {
+	s := newDiscardSpanTestAgent(true)
+	chunk := &pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{Name: "root", Metrics: map[string]float64{"_top_level": 1}}}}
+	span := chunk.Spans[0]
+
+	sm := &spanModifier{p0Verdicts: s.p0Verdicts}
+	sm.ModifySpan(chunk, span)
+
+	assert.True(t, s.discardSpan(span))
+	buckets := s.concentrator.Flush()
+	assert.Len(t, buckets, 1, "span stats must be recorded even though the span itself is dropped")
+}
+
+func TestDiscardSpanAppliesChunkVerdictUniformlyAcrossSpans(t *testing.T) {
+	s := newDiscardSpanTestAgent(true)
+	// A kept (priority > 0) chunk: none of its spans should be dropped, including ones
+	// that would look "unsampled" if judged in isolation.
+	chunk := &pb.TraceChunk{
+		Priority: 1,
+		Spans: []*pb.Span{
+			{Name: "root"},
+			{Name: "child-1"},
+			{Name: "child-2"},
+		},
+	}
+
+	sm := &spanModifier{p0Verdicts: s.p0Verdicts}
+	for _, span := range chunk.Spans {
+		sm.ModifySpan(chunk, span)
+		assert.False(t, s.discardSpan(span), "span %q of a kept chunk must not be dropped", span.Name)
+	}
+}
+
+func TestDiscardSpanWithoutDropP0sIgnoresVerdict(t *testing.T) {
+	s := newDiscardSpanTestAgent(false)
+	chunk := &pb.TraceChunk{Priority: 0, Spans: []*pb.Span{{Name: "root"}}}
+
+	assert.False(t, s.discardSpan(chunk.Spans[0]))
+}
+
+func TestFlushClientStatsNoopsWithoutConcentrator(t *testing.T) {
+	s := &ServerlessTraceAgent{}
+	assert.NotPanics(t, s.flushClientStats)
+}
+
+func TestSetTagsAndSetSpanRemappingNoopWithoutAgent(t *testing.T) {
+	s := &ServerlessTraceAgent{}
+	assert.NotPanics(t, func() {
+		s.SetTags(map[string]string{"env": "prod"})
+		s.SetSpanRemapping(map[string]string{"^a$": "b"}, nil)
+	})
+	assert.False(t, s.tagsLogged)
+}
+
+func TestFlushNoopsWithoutAgent(t *testing.T) {
+	s := &ServerlessTraceAgent{}
+	assert.NotPanics(t, s.Flush)
+	assert.Equal(t, 0, s.flushCount)
+}